@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-tdx-guest/verify/trust"
+)
+
+// pckCrlRedirectGetter wraps an HTTPSGetter, redirecting PCK CRL requests to
+// a configured base URL. TCB info and QE identity requests are left
+// untouched since verify.TdxQuote always fetches those from Intel's default
+// PCS endpoints (see the -pck-crl-url flag help in runVerify).
+type pckCrlRedirectGetter struct {
+	base  string
+	inner trust.HTTPSGetter
+}
+
+func (g *pckCrlRedirectGetter) Get(url string) (map[string][]string, []byte, error) {
+	if idx := strings.Index(url, "/pckcrl?"); idx != -1 {
+		url = strings.TrimRight(g.base, "/") + url[idx:]
+	}
+	return g.inner.Get(url)
+}
+
+// cachingGetter wraps an HTTPSGetter, persisting each successful response
+// (headers and body, as JSON) to dir (keyed by a hash of the requested URL)
+// and falling back to the cached
+// copy when the live fetch fails, so repeated verifications can run offline
+// once collateral has been fetched at least once.
+type cachingGetter struct {
+	dir   string
+	inner trust.HTTPSGetter
+}
+
+func newCachingGetter(dir string, inner trust.HTTPSGetter) *cachingGetter {
+	return &cachingGetter{dir: dir, inner: inner}
+}
+
+func (g *cachingGetter) Get(url string) (map[string][]string, []byte, error) {
+	cachePath := g.cachePath(url)
+	type cachedResponse struct {
+		Headers map[string][]string `json:"headers"`
+		Body    []byte              `json:"body"`
+	}
+
+	headers, body, err := g.inner.Get(url)
+	if err == nil {
+		if raw, mErr := json.Marshal(cachedResponse{Headers: headers, Body: body}); mErr == nil {
+			_ = ioutil.WriteFile(cachePath, raw, 0644)
+		}
+		return headers, body, nil
+	}
+
+	var cached cachedResponse
+	raw, cacheErr := ioutil.ReadFile(cachePath)
+	if cacheErr == nil {
+		cacheErr = json.Unmarshal(raw, &cached)
+	}
+	if cacheErr != nil {
+		return nil, nil, fmt.Errorf("fetching %s: %v (no cached copy available: %v)", url, err, cacheErr)
+	}
+	return cached.Headers, cached.Body, nil
+}
+
+func (g *cachingGetter) cachePath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(g.dir, hex.EncodeToString(sum[:])+".json")
+}
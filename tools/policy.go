@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	pb "github.com/google/go-tdx-guest/proto/tdx"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy gates a verified quote on measurement values, beyond signature
+// verification. Any field left unset is not checked.
+type Policy struct {
+	MrtdAllowlist  []string      `yaml:"mrtd_allowlist"`
+	Rtmr           []string      `yaml:"rtmr"`
+	MinTcbSvn      *MinTcbSvn    `yaml:"min_tcb_svn"`
+	MrSignerSeam   string        `yaml:"mrsignerseam"`
+	SeamAttributes string        `yaml:"seam_attributes"`
+	TdAttributes   *TdAttributes `yaml:"td_attributes"`
+	ReportData     string        `yaml:"report_data"`
+	ReportDataFile string        `yaml:"report_data_file"`
+}
+
+// MinTcbSvn is the minimum acceptable TCB SVN vector for the TDX and SGX
+// components of the platform.
+type MinTcbSvn struct {
+	Tdx []int `yaml:"tdx"`
+	Sgx []int `yaml:"sgx"`
+}
+
+// TdAttributes constrains individual bits of the TD_ATTRIBUTES field.
+// Only bits explicitly set (non-nil) are checked.
+type TdAttributes struct {
+	Debug         *bool `yaml:"debug"`
+	SeptVeDisable *bool `yaml:"sept_ve_disable"`
+}
+
+const (
+	tdAttributesDebugBit         = 0
+	tdAttributesSeptVeDisableBit = 28
+)
+
+// LoadPolicy reads and parses a policy YAML file.
+func LoadPolicy(path string) (*Policy, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy file: %v", err)
+	}
+	var policy Policy
+	if err := yaml.Unmarshal(raw, &policy); err != nil {
+		return nil, fmt.Errorf("parsing policy file: %v", err)
+	}
+	if policy.ReportDataFile != "" {
+		reportData, err := readReportData(policy.ReportDataFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading policy report_data_file: %v", err)
+		}
+		policy.ReportData = hex.EncodeToString(reportData[:])
+	}
+	return &policy, nil
+}
+
+// Evaluate checks quote against the policy and returns one diff line per
+// mismatched field. An empty result means the quote satisfies the policy.
+func (p *Policy) Evaluate(quote *pb.QuoteV4) []string {
+	var diffs []string
+	body := quote.GetTdQuoteBody()
+
+	if len(p.MrtdAllowlist) > 0 {
+		mrtd := hex.EncodeToString(body.GetMrTd())
+		if !contains(p.MrtdAllowlist, mrtd) {
+			diffs = append(diffs, fmt.Sprintf("mrtd: got %s, want one of %s", mrtd, strings.Join(p.MrtdAllowlist, ", ")))
+		}
+	}
+
+	rtmrs := body.GetRtmrs()
+	for i, want := range p.Rtmr {
+		if want == "*" || i >= len(rtmrs) {
+			continue
+		}
+		got := hex.EncodeToString(rtmrs[i])
+		if !strings.EqualFold(got, want) {
+			diffs = append(diffs, fmt.Sprintf("rtmr[%d]: got %s, want %s", i, got, want))
+		}
+	}
+
+	if p.MrSignerSeam != "" {
+		got := hex.EncodeToString(body.GetMrSignerSeam())
+		if !strings.EqualFold(got, p.MrSignerSeam) {
+			diffs = append(diffs, fmt.Sprintf("mrsignerseam: got %s, want %s", got, p.MrSignerSeam))
+		}
+	}
+
+	if p.SeamAttributes != "" {
+		got := hex.EncodeToString(body.GetSeamAttributes())
+		if !strings.EqualFold(got, p.SeamAttributes) {
+			diffs = append(diffs, fmt.Sprintf("seam_attributes: got %s, want %s", got, p.SeamAttributes))
+		}
+	}
+
+	if p.TdAttributes != nil {
+		attrs := body.GetTdAttributes()
+		if p.TdAttributes.Debug != nil {
+			if got := attributeBit(attrs, tdAttributesDebugBit); got != *p.TdAttributes.Debug {
+				diffs = append(diffs, fmt.Sprintf("td_attributes.debug: got %v, want %v", got, *p.TdAttributes.Debug))
+			}
+		}
+		if p.TdAttributes.SeptVeDisable != nil {
+			if got := attributeBit(attrs, tdAttributesSeptVeDisableBit); got != *p.TdAttributes.SeptVeDisable {
+				diffs = append(diffs, fmt.Sprintf("td_attributes.sept_ve_disable: got %v, want %v", got, *p.TdAttributes.SeptVeDisable))
+			}
+		}
+	}
+
+	if p.MinTcbSvn != nil {
+		if len(p.MinTcbSvn.Sgx) > 0 {
+			sgxTcbSvn, err := pckLeafTcbSvn(quote)
+			if err != nil {
+				diffs = append(diffs, fmt.Sprintf("min_tcb_svn.sgx: could not read TCB SVN from PCK certificate: %v", err))
+			} else {
+				diffs = append(diffs, checkMinTcbSvn("sgx_tcb_svn", sgxTcbSvn, p.MinTcbSvn.Sgx)...)
+			}
+		}
+		if len(p.MinTcbSvn.Tdx) > 0 {
+			diffs = append(diffs, checkMinTcbSvn("tdx_tcb_svn", body.GetTeeTcbSvn(), p.MinTcbSvn.Tdx)...)
+		}
+	}
+
+	if p.ReportData != "" {
+		got := hex.EncodeToString(body.GetReportData())
+		if !strings.EqualFold(got, p.ReportData) {
+			diffs = append(diffs, fmt.Sprintf("report_data: got %s, want %s", got, p.ReportData))
+		}
+	}
+
+	return diffs
+}
+
+// checkMinTcbSvn compares an SVN vector against a minimum, component by
+// component. name identifies the vector being checked in diff output.
+func checkMinTcbSvn(name string, got []byte, min []int) []string {
+	var diffs []string
+	for i, want := range min {
+		if i >= len(got) {
+			diffs = append(diffs, fmt.Sprintf("%s[%d]: not present in quote, want >= %d", name, i, want))
+			continue
+		}
+		if int(got[i]) < want {
+			diffs = append(diffs, fmt.Sprintf("%s[%d]: got %d, want >= %d", name, i, got[i], want))
+		}
+	}
+	return diffs
+}
+
+// Intel's SGX/TDX PCK certificate extension OIDs (see Intel SGX PCK
+// Certificate and Certificate Revocation List Profile Specification).
+var (
+	oidSgxExtension = asn1.ObjectIdentifier{1, 2, 840, 113741, 1, 13, 1}
+	oidSgxTcb       = asn1.ObjectIdentifier{1, 2, 840, 113741, 1, 13, 1, 2}
+)
+
+type sgxExtensionField struct {
+	Id    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+// pckLeafTcbSvn extracts the 16-byte SGX TCB component SVN vector from the
+// leaf PCK certificate's SGX extension.
+func pckLeafTcbSvn(quote *pb.QuoteV4) ([]byte, error) {
+	certs, err := pckCertChain(quote)
+	if err != nil {
+		return nil, err
+	}
+	leaf := certs[0]
+
+	var sgxExtDer []byte
+	for _, ext := range leaf.Extensions {
+		if ext.Id.Equal(oidSgxExtension) {
+			sgxExtDer = ext.Value
+			break
+		}
+	}
+	if sgxExtDer == nil {
+		return nil, fmt.Errorf("PCK leaf certificate has no SGX extension")
+	}
+
+	var fields []sgxExtensionField
+	if _, err := asn1.Unmarshal(sgxExtDer, &fields); err != nil {
+		return nil, fmt.Errorf("parsing SGX extension: %v", err)
+	}
+
+	for _, f := range fields {
+		if !f.Id.Equal(oidSgxTcb) {
+			continue
+		}
+		var tcbFields []sgxExtensionField
+		if _, err := asn1.Unmarshal(f.Value.FullBytes, &tcbFields); err != nil {
+			return nil, fmt.Errorf("parsing SGX TCB extension: %v", err)
+		}
+		svn := make([]byte, 0, 16)
+		for i := 1; i <= 16; i++ {
+			compOid := append(asn1.ObjectIdentifier{}, oidSgxTcb...)
+			compOid = append(compOid, i)
+			for _, tf := range tcbFields {
+				if tf.Id.Equal(compOid) {
+					var v int
+					if _, err := asn1.Unmarshal(tf.Value.FullBytes, &v); err == nil {
+						svn = append(svn, byte(v))
+					}
+				}
+			}
+		}
+		if len(svn) != 16 {
+			return nil, fmt.Errorf("SGX TCB extension is missing component SVN fields")
+		}
+		return svn, nil
+	}
+
+	return nil, fmt.Errorf("SGX extension has no TCB field")
+}
+
+func attributeBit(attrs []byte, bit int) bool {
+	byteIdx := bit / 8
+	if byteIdx >= len(attrs) {
+		return false
+	}
+	return attrs[byteIdx]&(1<<uint(bit%8)) != 0
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, h := range haystack {
+		if strings.EqualFold(h, needle) {
+			return true
+		}
+	}
+	return false
+}
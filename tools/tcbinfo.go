@@ -0,0 +1,26 @@
+package main
+
+import "regexp"
+
+// tcbStatusPattern matches the TCB status verify.TdxQuote's error carries
+// when a component's matched TCB level isn't UpToDate. checkTcbInfoTcbStatus
+// and checkQeTcbStatus in the go-tdx-guest verify package reject the quote
+// outright unless the matched level's status is "UpToDate", reporting the
+// real status in the error text ("TCB Status is not %q, found %q") — that
+// error is the only place a non-UpToDate status ever surfaces, since the
+// library authenticates the TCB info it checks against and we don't have
+// our own trusted channel to re-derive it.
+var tcbStatusPattern = regexp.MustCompile(`TCB Status is not "[^"]+", found "([^"]+)"`)
+
+// tcbStatusFromError extracts the TCB status reported in a verify.TdxQuote
+// failure, if the failure was in fact a TCB status mismatch.
+func tcbStatusFromError(verifyErr error) (string, bool) {
+	if verifyErr == nil {
+		return "", false
+	}
+	m := tcbStatusPattern.FindStringSubmatch(verifyErr.Error())
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
@@ -1,22 +1,66 @@
 package main
 
 import (
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/google/go-tdx-guest/abi"
+	"github.com/google/go-tdx-guest/client"
 	ccpb "github.com/google/go-tdx-guest/proto/checkconfig"
+	pb "github.com/google/go-tdx-guest/proto/tdx"
 	"github.com/google/go-tdx-guest/verify"
+	"github.com/google/go-tdx-guest/verify/trust"
 )
 
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <quote-file-path>\n", os.Args[0])
+	if len(os.Args) < 2 {
+		usage()
 		os.Exit(1)
 	}
 
-	quotePath := os.Args[1]
+	switch os.Args[1] {
+	case "verify":
+		runVerify(os.Args[2:])
+	case "quote":
+		runQuote(os.Args[2:])
+	default:
+		// Back-compat: `tdx-validator <quote-file-path>` still verifies.
+		runVerify(os.Args[1:])
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s verify [flags] <quote-file-path>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s quote <report-data-hex-or-file> <output-quote-path>\n", os.Args[0])
+}
+
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	getCollateral := fs.Bool("get-collateral", false, "fetch TCB info, QE identity, and PCK certs/CRLs from the Intel PCS")
+	checkCrl := fs.Bool("check-crl", false, "check the PCK certificate chain against CRLs (requires -get-collateral)")
+	pckCrlURL := fs.String("pck-crl-url", "", "base URL of the PCS API to fetch the PCK certificate CRL from (its /pckcrl path is appended; defaults to Intel's public PCS); TCB info and QE identity always come from Intel's default PCS endpoints")
+	rootCertPath := fs.String("root-cert", "", "path to a PEM file pinning the Intel SGX root CA certificate")
+	cacheDir := fs.String("collateral-cache-dir", "", "directory to persist fetched PCK CRLs, TCB info, and QE identity for offline reuse")
+	output := fs.String("output", "bool", "result format: \"bool\" for true/false, \"json\" for a structured report")
+	policyPath := fs.String("policy", "", "path to a policy YAML file gating acceptance on measurement values")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		usage()
+		os.Exit(1)
+	}
+	if *output != "bool" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Error: -output must be \"bool\" or \"json\"\n")
+		os.Exit(1)
+	}
+	quotePath := fs.Arg(0)
 
 	// Read the quote file
 	rawQuote, err := ioutil.ReadFile(quotePath)
@@ -32,24 +76,321 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Basic root of trust config
+	options, effectiveGetCollateral, source, err := buildVerifyOptions(*getCollateral, *checkCrl, *pckCrlURL, *rootCertPath, *cacheDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating verification options: %v\n", err)
+		os.Exit(1)
+	}
+	if *output == "bool" && source != "" {
+		fmt.Fprintf(os.Stderr, "collateral source: %s\n", source)
+	}
+
+	verifyErr := verify.TdxQuote(anyQuote, options)
+
+	var policyDiffs []string
+	if verifyErr == nil && *policyPath != "" {
+		policy, err := LoadPolicy(*policyPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading policy: %v\n", err)
+			os.Exit(1)
+		}
+		if quote, ok := anyQuote.(*pb.QuoteV4); ok {
+			policyDiffs = policy.Evaluate(quote)
+		} else {
+			policyDiffs = []string{"policy: quote is not a QuoteV4, cannot evaluate policy"}
+		}
+	}
+
+	if *output == "json" {
+		printJSONReport(anyQuote, verifyErr, effectiveGetCollateral, source, policyDiffs)
+		if verifyErr != nil || len(policyDiffs) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if verifyErr != nil {
+		fmt.Println("false")
+		os.Exit(1)
+	}
+	if len(policyDiffs) > 0 {
+		fmt.Println("false")
+		for _, d := range policyDiffs {
+			fmt.Fprintf(os.Stderr, "policy violation: %s\n", d)
+		}
+		os.Exit(1)
+	}
+	fmt.Println("true")
+}
+
+// VerificationReport is the structured, machine-readable result of
+// `verify -output json`, suitable for use as a building block in
+// attestation pipelines. It has no advisory-IDs field: reporting those
+// trustworthily would mean re-fetching and matching Intel's TCB info
+// ourselves rather than relying on the authenticated check inside
+// verify.TdxQuote (see tcbStatus), and that path isn't wired up yet.
+type VerificationReport struct {
+	Verified         bool     `json:"verified"`
+	Error            string   `json:"error,omitempty"`
+	TcbStatus        string   `json:"tcb_status"`
+	CollateralUsed   string   `json:"collateral_used"`
+	Header           Header   `json:"header"`
+	TdReport         TdReport `json:"td_report"`
+	PckCertSubjects  []string `json:"pck_cert_subjects,omitempty"`
+	PolicyViolations []string `json:"policy_violations,omitempty"`
+}
+
+// Header mirrors the fixed TDX quote header fields.
+type Header struct {
+	Version    uint32 `json:"version"`
+	TeeType    uint32 `json:"tee_type"`
+	QeVendorId string `json:"qe_vendor_id"`
+}
+
+// TdReport mirrors the measured fields of the TD report body.
+type TdReport struct {
+	MrTd          string   `json:"mr_td"`
+	MrConfigId    string   `json:"mr_config_id"`
+	MrOwner       string   `json:"mr_owner"`
+	MrOwnerConfig string   `json:"mr_owner_config"`
+	Rtmrs         []string `json:"rtmrs"`
+	ReportData    string   `json:"report_data"`
+}
+
+// printJSONReport decodes the verified (or attempted) quote into a
+// VerificationReport and writes it to stdout.
+func printJSONReport(anyQuote interface{}, verifyErr error, getCollateral bool, source string, policyDiffs []string) {
+	report := VerificationReport{
+		Verified:         verifyErr == nil && len(policyDiffs) == 0,
+		PolicyViolations: policyDiffs,
+	}
+	if verifyErr != nil {
+		report.Error = verifyErr.Error()
+	}
+
+	if source != "" {
+		report.CollateralUsed = source
+	} else {
+		report.CollateralUsed = "none (signature-only verification)"
+	}
+
+	if quote, ok := anyQuote.(*pb.QuoteV4); ok {
+		hdr := quote.GetHeader()
+		report.Header = Header{
+			Version:    hdr.GetVersion(),
+			TeeType:    hdr.GetTeeType(),
+			QeVendorId: hex.EncodeToString(hdr.GetQeVendorId()),
+		}
+
+		body := quote.GetTdQuoteBody()
+		rtmrs := make([]string, 0, 4)
+		for _, r := range body.GetRtmrs() {
+			rtmrs = append(rtmrs, hex.EncodeToString(r))
+		}
+		report.TdReport = TdReport{
+			MrTd:          hex.EncodeToString(body.GetMrTd()),
+			MrConfigId:    hex.EncodeToString(body.GetMrConfigId()),
+			MrOwner:       hex.EncodeToString(body.GetMrOwner()),
+			MrOwnerConfig: hex.EncodeToString(body.GetMrOwnerConfig()),
+			Rtmrs:         rtmrs,
+			ReportData:    hex.EncodeToString(body.GetReportData()),
+		}
+
+		report.PckCertSubjects = pckCertSubjects(quote)
+		report.TcbStatus = tcbStatus(verifyErr, getCollateral)
+	} else {
+		report.TcbStatus = "Unknown"
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+}
+
+// tcbStatus derives a TCB status (UpToDate, OutOfDate, Revoked,
+// ConfigurationNeeded, ...) from the outcome of verify.TdxQuote. With
+// -get-collateral, the verify package itself rejects any quote whose
+// matched TCB level isn't UpToDate, so a successful verification only ever
+// means UpToDate, and a failed one carries the real status in its error
+// text (see tcbStatusFromError) rather than in anything this tool could
+// re-derive on its own — re-fetching and matching TCB info ourselves would
+// mean trusting Intel's response without validating its signature chain
+// the way the library does internally. Without -get-collateral we haven't
+// fetched anything to evaluate against, so we report "NotChecked" — a
+// sentinel distinct from every real Intel status (ConfigurationNeeded
+// included), so pipelines can tell "we didn't check" from an actual
+// ConfigurationNeeded verdict.
+func tcbStatus(verifyErr error, getCollateral bool) string {
+	if !getCollateral {
+		return "NotChecked"
+	}
+	if verifyErr == nil {
+		return "UpToDate"
+	}
+	if status, ok := tcbStatusFromError(verifyErr); ok {
+		return status
+	}
+	return "Unknown"
+}
+
+// pckCertChain parses the quote's embedded PCK certificate chain (PEM
+// blocks, or DER if no PEM block is found), if present. The leaf
+// certificate is first.
+func pckCertChain(quote *pb.QuoteV4) ([]*x509.Certificate, error) {
+	certData := quote.GetSignedData().GetCertificationData().GetQeReportCertificationData().GetPckCertificateChainData().GetPckCertChain()
+	if len(certData) == 0 {
+		return nil, fmt.Errorf("quote does not embed a PCK certificate chain")
+	}
+	var certs []*x509.Certificate
+	for rest := certData; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return x509.ParseCertificates(certData)
+	}
+	return certs, nil
+}
+
+// pckCertSubjects extracts the subject of each certificate in the quote's
+// PCK certificate chain, if present.
+func pckCertSubjects(quote *pb.QuoteV4) []string {
+	certs, err := pckCertChain(quote)
+	if err != nil {
+		return nil
+	}
+	subjects := make([]string, 0, len(certs))
+	for _, c := range certs {
+		subjects = append(subjects, c.Subject.String())
+	}
+	return subjects
+}
+
+// buildVerifyOptions assembles verify.Options from the requested collateral
+// and CRL settings. It returns the resulting options, the effective
+// get-collateral setting (forced on by -collateral-cache-dir even if
+// -get-collateral wasn't passed), and a human-readable description of
+// where collateral will be pulled from.
+func buildVerifyOptions(getCollateral, checkCrl bool, pckCrlURL, rootCertPath, cacheDir string) (*verify.Options, bool, string, error) {
+	// -collateral-cache-dir only makes sense if we're actually fetching
+	// collateral; requesting a cache dir implies -get-collateral.
+	if cacheDir != "" {
+		getCollateral = true
+	}
+
 	rootConfig := &ccpb.RootOfTrust{
-		CheckCrl:      false,
-		GetCollateral: false,
+		CheckCrl:      checkCrl,
+		GetCollateral: getCollateral,
 	}
 
-	// Get verification options
 	options, err := verify.RootOfTrustToOptions(rootConfig)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating verification options: %v\n", err)
+		return nil, getCollateral, "", err
+	}
+
+	if rootCertPath != "" {
+		pemBytes, err := ioutil.ReadFile(rootCertPath)
+		if err != nil {
+			return nil, getCollateral, "", fmt.Errorf("reading pinned root cert: %v", err)
+		}
+		block, _ := pem.Decode(pemBytes)
+		if block == nil {
+			return nil, getCollateral, "", fmt.Errorf("no PEM block found in %q", rootCertPath)
+		}
+		rootCert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, getCollateral, "", fmt.Errorf("parsing pinned root cert: %v", err)
+		}
+		pool := x509.NewCertPool()
+		pool.AddCert(rootCert)
+		options.TrustedRoots = pool
+	}
+
+	source := "none (signature-only verification)"
+	if getCollateral {
+		var getter trust.HTTPSGetter = trust.DefaultHTTPSGetter()
+		source = "PCS (live fetch)"
+		if pckCrlURL != "" {
+			getter = &pckCrlRedirectGetter{base: pckCrlURL, inner: getter}
+			source = fmt.Sprintf("PCS (PCK CRL from %s, TCB info/QE identity from Intel's default PCS)", pckCrlURL)
+		}
+		if cacheDir != "" {
+			if err := os.MkdirAll(cacheDir, 0755); err != nil {
+				return nil, getCollateral, "", fmt.Errorf("creating collateral cache dir: %v", err)
+			}
+			getter = newCachingGetter(cacheDir, getter)
+			source = fmt.Sprintf("PCS (cached under %s)", cacheDir)
+		}
+		options.Getter = getter
+	}
+
+	return options, getCollateral, source, nil
+}
+
+func runQuote(args []string) {
+	if len(args) != 2 {
+		usage()
 		os.Exit(1)
 	}
 
-	// Verify the quote
-	if err := verify.TdxQuote(anyQuote, options); err != nil {
-		fmt.Println("false")
+	reportData, err := readReportData(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading report data: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Println("true")
+	outPath := args[1]
+
+	rawQuote, err := getRawQuote(reportData)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting quote: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := ioutil.WriteFile(outPath, rawQuote, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing quote: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// readReportData accepts either a 64-byte hex string or a path to a file
+// containing the raw 64 bytes of report data.
+func readReportData(arg string) ([64]byte, error) {
+	var reportData [64]byte
+
+	if decoded, err := hex.DecodeString(strings.TrimSpace(arg)); err == nil && len(decoded) == 64 {
+		copy(reportData[:], decoded)
+		return reportData, nil
+	}
+
+	raw, err := ioutil.ReadFile(arg)
+	if err != nil {
+		return reportData, fmt.Errorf("%q is neither a 64-byte hex string nor a readable file: %v", arg, err)
+	}
+	if len(raw) != 64 {
+		return reportData, fmt.Errorf("report data file %q must contain exactly 64 bytes, got %d", arg, len(raw))
+	}
+	copy(reportData[:], raw)
+	return reportData, nil
+}
+
+// getRawQuote pulls a quote via ConfigFS TSM when available, falling back to
+// the legacy /dev/tdx_guest ioctl interface otherwise. client.GetRawQuote
+// already implements that fallback internally (see
+// fallbackToDeviceForRawQuote in go-tdx-guest/client), so there's nothing
+// left for this tool to do beyond picking a provider.
+func getRawQuote(reportData [64]byte) ([]byte, error) {
+	qp, err := client.GetQuoteProvider()
+	if err != nil {
+		return nil, fmt.Errorf("no ConfigFS TSM quote provider available: %v", err)
+	}
+	return client.GetRawQuote(qp, reportData)
 }